@@ -0,0 +1,121 @@
+// Copyright (C) The Arvados Authors. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package arvados
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+)
+
+// Client holds connection and authentication details for the
+// Arvados API server.
+type Client struct {
+	APIHost   string
+	AuthToken string
+	Insecure  bool
+
+	HTTPClient *http.Client
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: c.Insecure},
+	}}
+}
+
+// RequestAndDecode performs an API request and unmarshals the
+// response (which must be JSON) into dst. path is relative to the API
+// host, e.g. "arvados/v1/collections". params, if not nil, is sent as
+// a JSON-encoded "?_method=GET"-style query parameter for GET/HEAD
+// requests, or merged into the request body otherwise.
+func (c *Client) RequestAndDecode(dst interface{}, method, path string, body io.Reader, params interface{}) error {
+	u := fmt.Sprintf("https://%s/%s", strings.TrimSuffix(c.APIHost, "/"), strings.TrimPrefix(path, "/"))
+
+	if params != nil {
+		j, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+		switch method {
+		case "GET", "HEAD":
+			u += "?" + (url.Values{"params": {string(j)}}).Encode()
+		default:
+			if body == nil {
+				body = bytes.NewReader(j)
+			}
+		}
+	}
+
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "OAuth2 "+c.AuthToken)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		errBody, _ := ioutil.ReadAll(&io.LimitedReader{R: resp.Body, N: 4096})
+		return fmt.Errorf("%s %s: %d %s", method, path, resp.StatusCode, bytes.TrimSpace(errBody))
+	}
+	if dst == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(dst)
+}
+
+// UpdateBody returns a reader suitable for use as the body of a POST
+// or PATCH request that creates or updates obj: the JSON-encoded
+// attributes of obj, wrapped in an object keyed by obj's (lowercased)
+// type name, e.g. {"collection": {"name": "foo", ...}} for a
+// *Collection. This matches the attribute-wrapping the API server
+// expects for create/update requests.
+func (c *Client) UpdateBody(obj interface{}) io.Reader {
+	attrs, err := json.Marshal(obj)
+	if err != nil {
+		return nil
+	}
+	t := reflect.TypeOf(obj)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	body, err := wrapAttrs(strings.ToLower(t.Name()), attrs)
+	if err != nil {
+		return nil
+	}
+	return body
+}
+
+// wrapAttrs wraps already-marshaled attrs in an object keyed by key,
+// e.g. wrapAttrs("group", `{"name":"foo"}`) ->
+// `{"group":{"name":"foo"}}`. It's the attribute-wrapping convention
+// UpdateBody uses for typed objects, factored out so callers that only
+// have a resource type name and a map of attributes (not a typed
+// object to pass to UpdateBody) can follow the same convention.
+func wrapAttrs(key string, attrs json.RawMessage) (io.Reader, error) {
+	body, err := json.Marshal(map[string]json.RawMessage{key: attrs})
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(body), nil
+}
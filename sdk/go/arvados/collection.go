@@ -0,0 +1,16 @@
+// Copyright (C) The Arvados Authors. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package arvados
+
+import "time"
+
+// Collection is an Arvados collection.
+type Collection struct {
+	UUID         string     `json:"uuid,omitempty"`
+	OwnerUUID    string     `json:"owner_uuid,omitempty"`
+	Name         string     `json:"name,omitempty"`
+	ManifestText string     `json:"manifest_text,omitempty"`
+	TrashAt      *time.Time `json:"trash_at,omitempty"`
+}
@@ -0,0 +1,61 @@
+// Copyright (C) The Arvados Authors. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package arvados
+
+import (
+	"os"
+	"time"
+)
+
+// inode is a node in the SiteFS tree: a project, a collection, or (in
+// a fuller implementation) a file or directory within a collection.
+// Every inode knows its parent and can produce an os.FileInfo for
+// Stat()/Readdir().
+type inode interface {
+	Parent() inode
+	SetParent(parent inode, name string)
+	FileInfo() os.FileInfo
+	IsDir() bool
+}
+
+// FileSystem is the interface implemented by SiteFS (CustomFileSystem)
+// and the filesystems mounted within it.
+type FileSystem interface {
+	Open(name string) (File, error)
+	OpenFile(name string, flag int, perm os.FileMode) (File, error)
+	Mkdir(name string, perm os.FileMode) error
+	Rename(oldname, newname string) error
+	Remove(name string) error
+	Sync() error
+}
+
+// File is a single open file or directory handle.
+type File interface {
+	Stat() (os.FileInfo, error)
+	Readdir(n int) ([]os.FileInfo, error)
+	Read(p []byte) (int, error)
+	Write(p []byte) (int, error)
+	Close() error
+
+	// Sync reloads this handle's node from the API server, if it
+	// names a project; it's a no-op for other node types.
+	Sync() error
+}
+
+// simpleFileInfo is a minimal os.FileInfo for inodes that don't need
+// to track more than a name, a mode, and a modification time.
+type simpleFileInfo struct {
+	name    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+}
+
+func (fi simpleFileInfo) Name() string       { return fi.name }
+func (fi simpleFileInfo) Size() int64        { return fi.size }
+func (fi simpleFileInfo) Mode() os.FileMode  { return fi.mode }
+func (fi simpleFileInfo) ModTime() time.Time { return fi.modTime }
+func (fi simpleFileInfo) IsDir() bool        { return fi.mode.IsDir() }
+func (fi simpleFileInfo) Sys() interface{}   { return nil }
@@ -0,0 +1,166 @@
+// Copyright (C) The Arvados Authors. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package arvados
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// keepGetter is the subset of *keepclient.KeepClient that
+// collectionFileNode needs in order to read file content out of
+// Keep. Depending on an interface here (instead of importing
+// keepclient directly) keeps this package's only dependency on Keep
+// narrow and easy to fake in tests.
+type keepGetter interface {
+	GetRange(locator string, offset, length int64) (io.ReadCloser, int64, string, error)
+}
+
+// collectionDirNode mounts a collection as a directory within the
+// project tree. Listing and renaming/removing a collection (as an
+// entry in its owning project) is supported, as is reading the
+// content of the files named in its manifest (lazily, a range at a
+// time, via kc); writing file content is not implemented here and is
+// the job of a fuller collectionFileSystem.
+type collectionDirNode struct {
+	client *Client
+	kc     keepGetter
+	uuid   string
+	name   string
+	parent inode
+
+	mtx      sync.Mutex
+	children map[string]inode
+	loaded   bool
+}
+
+func (n *collectionDirNode) Parent() inode { return n.parent }
+func (n *collectionDirNode) SetParent(parent inode, name string) {
+	n.parent = parent
+	n.name = name
+}
+func (n *collectionDirNode) IsDir() bool { return true }
+func (n *collectionDirNode) FileInfo() os.FileInfo {
+	return simpleFileInfo{name: n.name, mode: os.ModeDir | 0755, modTime: time.Now()}
+}
+
+// ensureLoaded fetches this collection's manifest text, if it hasn't
+// been fetched yet, and parses it into the files in n.children.
+// Callers must hold n.mtx.
+func (n *collectionDirNode) ensureLoaded() error {
+	if n.loaded {
+		return nil
+	}
+	var coll Collection
+	if err := n.client.RequestAndDecode(&coll, "GET", "arvados/v1/collections/"+n.uuid, nil, nil); err != nil {
+		return fmt.Errorf("loading collection %s: %v", n.uuid, err)
+	}
+	files, err := parseManifestFiles(coll.ManifestText)
+	if err != nil {
+		return err
+	}
+	children := make(map[string]inode, len(files))
+	for name, f := range files {
+		children[name] = &collectionFileNode{parent: n, kc: n.kc, name: name, size: f.size, segments: f.segments}
+	}
+	n.children = children
+	n.loaded = true
+	return nil
+}
+
+// child returns the named file within the collection, fetching the
+// manifest first if it hasn't been loaded yet.
+func (n *collectionDirNode) child(name string) (inode, error) {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	if err := n.ensureLoaded(); err != nil {
+		return nil, err
+	}
+	child, ok := n.children[name]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return child, nil
+}
+
+func (n *collectionDirNode) readdir() ([]os.FileInfo, error) {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	if err := n.ensureLoaded(); err != nil {
+		return nil, err
+	}
+	fis := make([]os.FileInfo, 0, len(n.children))
+	for _, child := range n.children {
+		fis = append(fis, child.FileInfo())
+	}
+	return fis, nil
+}
+
+// collectionFileNode is a read-only file within a collection. Its
+// content is not held in memory: each Read fetches only the bytes
+// requested, a segment at a time, via kc.GetRange -- so a small seek
+// into a large file doesn't pull the whole block it lives in, let
+// alone the whole file.
+type collectionFileNode struct {
+	parent   *collectionDirNode
+	kc       keepGetter
+	name     string
+	size     int64
+	segments []fileSegment
+}
+
+func (n *collectionFileNode) Parent() inode { return n.parent }
+func (n *collectionFileNode) SetParent(parent inode, name string) {
+	// Files are reloaded wholesale by collectionDirNode.ensureLoaded
+	// on the next Sync, rather than renamed in place.
+}
+func (n *collectionFileNode) IsDir() bool { return false }
+func (n *collectionFileNode) FileInfo() os.FileInfo {
+	return simpleFileInfo{name: n.name, size: n.size, mode: 0644, modTime: time.Now()}
+}
+
+// readAt reads up to len(p) bytes starting at offset pos in the
+// file's content, fetching only the Keep ranges that overlap
+// [pos, pos+len(p)).
+func (n *collectionFileNode) readAt(p []byte, pos int64) (int, error) {
+	if n.kc == nil {
+		return 0, fmt.Errorf("reading %q: no Keep client configured", n.name)
+	}
+	if pos >= n.size {
+		return 0, io.EOF
+	}
+	var done int
+	var segStart int64
+	for _, seg := range n.segments {
+		segEnd := segStart + seg.length
+		if segEnd <= pos || len(p) == done {
+			segStart = segEnd
+			continue
+		}
+		readStart := pos + int64(done) - segStart
+		if readStart < 0 {
+			readStart = 0
+		}
+		readLen := seg.length - readStart
+		if want := int64(len(p) - done); readLen > want {
+			readLen = want
+		}
+		rdr, _, _, err := n.kc.GetRange(seg.locator, seg.offset+readStart, readLen)
+		if err != nil {
+			return done, fmt.Errorf("reading %q: %v", n.name, err)
+		}
+		nread, err := io.ReadFull(rdr, p[done:int64(done)+readLen])
+		rdr.Close()
+		done += nread
+		if err != nil {
+			return done, fmt.Errorf("reading %q: %v", n.name, err)
+		}
+		segStart = segEnd
+	}
+	return done, nil
+}
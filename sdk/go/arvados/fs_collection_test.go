@@ -0,0 +1,95 @@
+// Copyright (C) The Arvados Authors. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package arvados
+
+import (
+	"io"
+	"io/ioutil"
+	"strings"
+
+	check "gopkg.in/check.v1"
+)
+
+type CollectionFileSuite struct{}
+
+var _ = check.Suite(&CollectionFileSuite{})
+
+// fakeKeepGetter is an in-memory keepGetter backed by a fixed set of
+// blocks, for testing collectionFileNode.readAt without a real Keep
+// client.
+type fakeKeepGetter map[string][]byte
+
+func (f fakeKeepGetter) GetRange(locator string, offset, length int64) (io.ReadCloser, int64, string, error) {
+	data := f[locator]
+	return ioutil.NopCloser(strings.NewReader(string(data[offset : offset+length]))), length, "", nil
+}
+
+func (s *CollectionFileSuite) TestParseManifestFiles(c *check.C) {
+	manifest := ". acbd18db4cc2f85cedef654fccc4a4d8+3 37b51d194a7513e45b56f6524f2d51f2+3 0:3:foo.txt 3:3:bar.txt\n"
+	files, err := parseManifestFiles(manifest)
+	c.Assert(err, check.IsNil)
+	c.Assert(files, check.HasLen, 2)
+
+	foo := files["foo.txt"]
+	c.Assert(foo, check.NotNil)
+	c.Check(foo.size, check.Equals, int64(3))
+	c.Assert(foo.segments, check.HasLen, 1)
+	c.Check(foo.segments[0].locator, check.Equals, "acbd18db4cc2f85cedef654fccc4a4d8+3")
+	c.Check(foo.segments[0].offset, check.Equals, int64(0))
+	c.Check(foo.segments[0].length, check.Equals, int64(3))
+
+	bar := files["bar.txt"]
+	c.Assert(bar, check.NotNil)
+	c.Check(bar.size, check.Equals, int64(3))
+	c.Assert(bar.segments, check.HasLen, 1)
+	c.Check(bar.segments[0].locator, check.Equals, "37b51d194a7513e45b56f6524f2d51f2+3")
+	c.Check(bar.segments[0].offset, check.Equals, int64(0))
+}
+
+func (s *CollectionFileSuite) TestParseManifestFilesSpansBlocks(c *check.C) {
+	// A single file whose content spans two blocks.
+	manifest := ". acbd18db4cc2f85cedef654fccc4a4d8+3 37b51d194a7513e45b56f6524f2d51f2+3 0:6:foobar.txt\n"
+	files, err := parseManifestFiles(manifest)
+	c.Assert(err, check.IsNil)
+	f := files["foobar.txt"]
+	c.Assert(f, check.NotNil)
+	c.Check(f.size, check.Equals, int64(6))
+	c.Assert(f.segments, check.HasLen, 2)
+	c.Check(f.segments[0].locator, check.Equals, "acbd18db4cc2f85cedef654fccc4a4d8+3")
+	c.Check(f.segments[0].length, check.Equals, int64(3))
+	c.Check(f.segments[1].locator, check.Equals, "37b51d194a7513e45b56f6524f2d51f2+3")
+	c.Check(f.segments[1].length, check.Equals, int64(3))
+}
+
+// TestCollectionFileRead exercises a file read end to end: parsing a
+// manifest, then reading a byte range through fileHandle.Read, which
+// should fetch only the requested range from Keep (via GetRange), not
+// the whole file.
+func (s *CollectionFileSuite) TestCollectionFileRead(c *check.C) {
+	kc := fakeKeepGetter{
+		"block1+6": []byte("foobar"),
+		"block2+6": []byte("bazqux"),
+	}
+	node := &collectionFileNode{
+		kc:   kc,
+		name: "combined.txt",
+		size: 12,
+		segments: []fileSegment{
+			{locator: "block1+6", offset: 0, length: 6},
+			{locator: "block2+6", offset: 0, length: 6},
+		},
+	}
+	h := &fileHandle{node: node}
+
+	buf := make([]byte, 5)
+	n, err := h.Read(buf)
+	c.Assert(err, check.IsNil)
+	c.Check(string(buf[:n]), check.Equals, "fooba")
+
+	buf2 := make([]byte, 20)
+	n, err = h.Read(buf2)
+	c.Check(err == nil || err == io.EOF, check.Equals, true)
+	c.Check(string(buf2[:n]), check.Equals, "rbazqux")
+}
@@ -0,0 +1,327 @@
+// Copyright (C) The Arvados Authors. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package arvados
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+// projectNode is a directory inode backed by an Arvados project (a
+// Group with GroupClass "project"). Its children -- subprojects and
+// collections owned by the project -- are discovered by Sync(), and
+// cached until the next Sync().
+//
+// isHome is set on the single node mounted at /home: it lists every
+// project the current user can see, rather than the children of one
+// particular project.
+type projectNode struct {
+	client *Client
+	kc     keepGetter
+	uuid   string
+	name   string
+	isHome bool
+
+	parent inode
+
+	mtx      sync.Mutex
+	children map[string]inode
+	loaded   bool
+}
+
+func (pn *projectNode) Parent() inode { return pn.parent }
+func (pn *projectNode) SetParent(parent inode, name string) {
+	pn.parent = parent
+	pn.name = name
+}
+func (pn *projectNode) IsDir() bool { return true }
+func (pn *projectNode) FileInfo() os.FileInfo {
+	return simpleFileInfo{name: pn.name, mode: os.ModeDir | 0755, modTime: time.Now()}
+}
+
+// Sync reloads the project's children from the API server, so
+// out-of-band changes (another client creating, renaming, or
+// deleting a collection or subproject) become visible.
+func (pn *projectNode) Sync() error {
+	pn.mtx.Lock()
+	defer pn.mtx.Unlock()
+	return pn.syncLocked()
+}
+
+// syncLocked does the work of Sync(). Callers must hold pn.mtx.
+func (pn *projectNode) syncLocked() error {
+	children := make(map[string]inode)
+
+	// Collections and subprojects are independent requests; run them
+	// concurrently so Sync() pays for one round trip, not two.
+	var collections struct {
+		Items []Collection `json:"items"`
+	}
+	var groups struct {
+		Items []Group `json:"items"`
+	}
+	var collErr, groupErr error
+	var wg sync.WaitGroup
+
+	if !pn.isHome {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			collErr = pn.client.RequestAndDecode(&collections, "GET", "arvados/v1/collections", nil, map[string]interface{}{
+				"filters": [][]interface{}{{"owner_uuid", "=", pn.uuid}},
+				"count":   "none",
+			})
+		}()
+	}
+
+	groupFilters := [][]interface{}{{"group_class", "=", "project"}}
+	if !pn.isHome {
+		groupFilters = append(groupFilters, []interface{}{"owner_uuid", "=", pn.uuid})
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		groupErr = pn.client.RequestAndDecode(&groups, "GET", "arvados/v1/groups", nil, map[string]interface{}{
+			"filters": groupFilters,
+			"count":   "none",
+		})
+	}()
+	wg.Wait()
+
+	if collErr != nil {
+		return fmt.Errorf("listing collections in %s: %v", pn.uuid, collErr)
+	}
+	if groupErr != nil {
+		return fmt.Errorf("listing subprojects in %s: %v", pn.uuid, groupErr)
+	}
+	for _, coll := range collections.Items {
+		children[coll.Name] = &collectionDirNode{client: pn.client, kc: pn.kc, uuid: coll.UUID, name: coll.Name}
+	}
+	for _, grp := range groups.Items {
+		// If we already have this subproject cached (by uuid),
+		// keep the existing node -- and its already-loaded
+		// children -- instead of discarding it.
+		if existing, ok := pn.children[grp.Name]; ok {
+			if sub, ok := existing.(*projectNode); ok && sub.uuid == grp.UUID {
+				children[grp.Name] = sub
+				continue
+			}
+		}
+		children[grp.Name] = &projectNode{client: pn.client, kc: pn.kc, uuid: grp.UUID, name: grp.Name}
+	}
+
+	for name, child := range children {
+		child.SetParent(pn, name)
+	}
+	pn.children = children
+	pn.loaded = true
+	return nil
+}
+
+func (pn *projectNode) ensureLoaded() error {
+	if !pn.loaded {
+		return pn.syncLocked()
+	}
+	return nil
+}
+
+// child returns the named child, loading the project's children from
+// the API first if they haven't been loaded yet.
+func (pn *projectNode) child(name string) (inode, error) {
+	pn.mtx.Lock()
+	defer pn.mtx.Unlock()
+	if err := pn.ensureLoaded(); err != nil {
+		return nil, err
+	}
+	child, ok := pn.children[name]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return child, nil
+}
+
+// readdir returns the FileInfo of the project's children, loading
+// them from the API first if they haven't been loaded yet.
+func (pn *projectNode) readdir() ([]os.FileInfo, error) {
+	pn.mtx.Lock()
+	defer pn.mtx.Unlock()
+	if err := pn.ensureLoaded(); err != nil {
+		return nil, err
+	}
+	fis := make([]os.FileInfo, 0, len(pn.children))
+	for _, child := range pn.children {
+		fis = append(fis, child.FileInfo())
+	}
+	return fis, nil
+}
+
+// mkdir creates a new subproject named name, via POST
+// arvados/v1/groups with group_class=project.
+func (pn *projectNode) mkdir(name string) (inode, error) {
+	if pn.isHome {
+		return nil, fmt.Errorf("cannot create %q: /home is not itself a project", name)
+	}
+	pn.mtx.Lock()
+	defer pn.mtx.Unlock()
+	if err := pn.ensureLoaded(); err != nil {
+		return nil, err
+	}
+	if _, exists := pn.children[name]; exists {
+		return nil, os.ErrExist
+	}
+
+	grp := Group{Name: name, OwnerUUID: pn.uuid, GroupClass: "project"}
+	var created Group
+	err := pn.client.RequestAndDecode(&created, "POST", "arvados/v1/groups", pn.client.UpdateBody(&grp), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	child := &projectNode{client: pn.client, kc: pn.kc, uuid: created.UUID, name: name, parent: pn, loaded: true, children: map[string]inode{}}
+	pn.children[name] = child
+	return child, nil
+}
+
+// remove removes the named child. A collection is trashed outright; a
+// subproject is trashed only if it has no children of its own.
+func (pn *projectNode) remove(name string) error {
+	pn.mtx.Lock()
+	if err := pn.ensureLoaded(); err != nil {
+		pn.mtx.Unlock()
+		return err
+	}
+	child, ok := pn.children[name]
+	if !ok {
+		pn.mtx.Unlock()
+		return os.ErrNotExist
+	}
+
+	// If the child is itself a project, we'll need its mtx too (to
+	// check it's empty). Re-acquire both locks in the same
+	// pointer-address order rename() uses, so this can't deadlock
+	// against a concurrent rename of the same pair of projects. Both
+	// locks are held for the rest of the call -- including the
+	// trash request -- so a concurrent remove(), rename(), or
+	// Sync() can't race with the delete(pn.children, name) below.
+	sub, isProject := child.(*projectNode)
+	if isProject {
+		pn.mtx.Unlock()
+		unlock := lockProjectPair(pn, sub)
+		defer unlock()
+		if err := pn.ensureLoaded(); err != nil {
+			return err
+		}
+		if child, ok = pn.children[name]; !ok || child != inode(sub) {
+			return os.ErrNotExist
+		}
+	} else {
+		defer pn.mtx.Unlock()
+	}
+
+	switch n := child.(type) {
+	case *projectNode:
+		if err := n.ensureLoaded(); err != nil {
+			return err
+		}
+		if len(n.children) != 0 {
+			return fmt.Errorf("project %q is not empty", name)
+		}
+		if err := pn.client.RequestAndDecode(nil, "POST", "arvados/v1/groups/"+n.uuid+"/trash", nil, nil); err != nil {
+			return err
+		}
+	case *collectionDirNode:
+		if err := pn.client.RequestAndDecode(nil, "POST", "arvados/v1/collections/"+n.uuid+"/trash", nil, nil); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("cannot remove %q: unsupported inode type %T", name, n)
+	}
+
+	delete(pn.children, name)
+	return nil
+}
+
+// rename moves/renames the child named name to newname under
+// newparent (which may be pn itself). It updates the child's name
+// and, if it's moving to a different project, its owner_uuid, with a
+// single PATCH request, then fixes up both projects' caches.
+func (pn *projectNode) rename(name string, newparent *projectNode, newname string) error {
+	if newparent.isHome {
+		return fmt.Errorf("cannot move %q to /home: /home is not itself a project", name)
+	}
+	unlock := lockProjectPair(pn, newparent)
+	defer unlock()
+
+	if err := pn.ensureLoaded(); err != nil {
+		return err
+	}
+	child, ok := pn.children[name]
+	if !ok {
+		return os.ErrNotExist
+	}
+	if newparent != pn {
+		if err := newparent.ensureLoaded(); err != nil {
+			return err
+		}
+	}
+	if existing, exists := newparent.children[newname]; exists && existing != child {
+		return os.ErrExist
+	}
+
+	attrs := map[string]interface{}{"name": newname}
+	if newparent != pn {
+		attrs["owner_uuid"] = newparent.uuid
+	}
+
+	var endpoint, resourceKey string
+	switch n := child.(type) {
+	case *projectNode:
+		endpoint, resourceKey = "arvados/v1/groups/"+n.uuid, "group"
+	case *collectionDirNode:
+		endpoint, resourceKey = "arvados/v1/collections/"+n.uuid, "collection"
+	default:
+		return fmt.Errorf("cannot rename %q: unsupported inode type %T", name, n)
+	}
+	attrsJSON, err := json.Marshal(attrs)
+	if err != nil {
+		return err
+	}
+	patch, err := wrapAttrs(resourceKey, attrsJSON)
+	if err != nil {
+		return err
+	}
+	if err := pn.client.RequestAndDecode(nil, "PATCH", endpoint, patch, nil); err != nil {
+		return err
+	}
+
+	delete(pn.children, name)
+	child.SetParent(newparent, newname)
+	newparent.children[newname] = child
+	return nil
+}
+
+// lockProjectPair locks one or two projectNodes (in a consistent
+// order, to avoid deadlocking against a concurrent rename the other
+// way) and returns a function that unlocks them.
+func lockProjectPair(a, b *projectNode) func() {
+	if a == b {
+		a.mtx.Lock()
+		return a.mtx.Unlock
+	}
+	first, second := a, b
+	if uintptr(unsafe.Pointer(a)) > uintptr(unsafe.Pointer(b)) {
+		first, second = b, a
+	}
+	first.mtx.Lock()
+	second.mtx.Lock()
+	return func() {
+		second.mtx.Unlock()
+		first.mtx.Unlock()
+	}
+}
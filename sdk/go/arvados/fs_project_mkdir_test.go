@@ -0,0 +1,138 @@
+// Copyright (C) The Arvados Authors. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package arvados
+
+import (
+	"os"
+
+	"git.curoverse.com/arvados.git/sdk/go/arvadostest"
+	check "gopkg.in/check.v1"
+)
+
+// These tests parallel TestProjectUpdatedByOther in
+// fs_project_test.go, but exercise writes made through SiteFS itself
+// (Mkdir, Rename, Remove) rather than out-of-band API calls, and
+// confirm the project layer reflects them immediately -- and after a
+// Sync(), that the server agrees.
+func (s *SiteFSSuite) TestProjectMkdir(c *check.C) {
+	project, err := s.fs.OpenFile("/home/A Project", 0, 0)
+	c.Assert(err, check.IsNil)
+
+	err = s.fs.Mkdir("/home/A Project/new project", 0755)
+	c.Assert(err, check.IsNil)
+
+	f, err := s.fs.Open("/home/A Project/new project")
+	c.Assert(err, check.IsNil)
+	fi, err := f.Stat()
+	c.Assert(err, check.IsNil)
+	c.Check(fi.IsDir(), check.Equals, true)
+	f.Close()
+
+	// A second Mkdir with the same name should fail, whether or
+	// not the first has been synced to the server yet.
+	err = s.fs.Mkdir("/home/A Project/new project", 0755)
+	c.Check(err, check.NotNil)
+
+	err = project.Sync()
+	c.Check(err, check.IsNil)
+	f, err = s.fs.Open("/home/A Project/new project")
+	c.Assert(err, check.IsNil)
+	fi, err = f.Stat()
+	c.Assert(err, check.IsNil)
+	c.Check(fi.IsDir(), check.Equals, true)
+}
+
+func (s *SiteFSSuite) TestProjectRename(c *check.C) {
+	project, err := s.fs.OpenFile("/home/A Project", 0, 0)
+	c.Assert(err, check.IsNil)
+
+	err = s.fs.Mkdir("/home/A Project/to rename", 0755)
+	c.Assert(err, check.IsNil)
+
+	err = s.fs.Rename("/home/A Project/to rename", "/home/A Project/renamed")
+	c.Assert(err, check.IsNil)
+
+	_, err = s.fs.Open("/home/A Project/to rename")
+	c.Check(err, check.NotNil)
+	c.Check(os.IsNotExist(err), check.Equals, true)
+
+	f, err := s.fs.Open("/home/A Project/renamed")
+	c.Assert(err, check.IsNil)
+	fi, err := f.Stat()
+	c.Assert(err, check.IsNil)
+	c.Check(fi.IsDir(), check.Equals, true)
+	f.Close()
+
+	err = project.Sync()
+	c.Check(err, check.IsNil)
+	_, err = s.fs.Open("/home/A Project/renamed")
+	c.Check(err, check.IsNil)
+}
+
+func (s *SiteFSSuite) TestProjectRenameBetweenProjects(c *check.C) {
+	err := s.fs.Mkdir("/home/A Project/move me", 0755)
+	c.Assert(err, check.IsNil)
+
+	err = s.fs.Rename("/home/A Project/move me", "/home/A Project/A Subproject/moved")
+	c.Assert(err, check.IsNil)
+
+	_, err = s.fs.Open("/home/A Project/move me")
+	c.Check(err, check.NotNil)
+
+	f, err := s.fs.Open("/home/A Project/A Subproject/moved")
+	c.Assert(err, check.IsNil)
+	fi, err := f.Stat()
+	c.Assert(err, check.IsNil)
+	c.Check(fi.IsDir(), check.Equals, true)
+}
+
+func (s *SiteFSSuite) TestProjectRenameNameConflict(c *check.C) {
+	err := s.fs.Mkdir("/home/A Project/conflict", 0755)
+	c.Assert(err, check.IsNil)
+
+	oob := Collection{
+		Name:      "conflict",
+		OwnerUUID: arvadostest.AProjectUUID,
+	}
+	err = s.client.RequestAndDecode(&oob, "POST", "arvados/v1/collections", s.client.UpdateBody(&oob), nil)
+	c.Assert(err, check.IsNil)
+	defer s.client.RequestAndDecode(nil, "DELETE", "arvados/v1/collections/"+oob.UUID, nil, nil)
+
+	err = s.fs.Mkdir("/home/A Project/other", 0755)
+	c.Assert(err, check.IsNil)
+
+	// Renaming "other" on top of an existing collection named
+	// "conflict" should fail rather than silently clobbering it.
+	err = s.fs.Rename("/home/A Project/other", "/home/A Project/conflict")
+	c.Check(err, check.NotNil)
+}
+
+func (s *SiteFSSuite) TestProjectRmdir(c *check.C) {
+	project, err := s.fs.OpenFile("/home/A Project", 0, 0)
+	c.Assert(err, check.IsNil)
+
+	err = s.fs.Mkdir("/home/A Project/to remove", 0755)
+	c.Assert(err, check.IsNil)
+
+	// Remove should refuse to trash a non-empty subproject.
+	err = s.fs.Mkdir("/home/A Project/to remove/occupant", 0755)
+	c.Assert(err, check.IsNil)
+	err = s.fs.Remove("/home/A Project/to remove")
+	c.Check(err, check.NotNil)
+
+	err = s.fs.Remove("/home/A Project/to remove/occupant")
+	c.Assert(err, check.IsNil)
+	err = s.fs.Remove("/home/A Project/to remove")
+	c.Assert(err, check.IsNil)
+
+	_, err = s.fs.Open("/home/A Project/to remove")
+	c.Check(err, check.NotNil)
+	c.Check(os.IsNotExist(err), check.Equals, true)
+
+	err = project.Sync()
+	c.Check(err, check.IsNil)
+	_, err = s.fs.Open("/home/A Project/to remove")
+	c.Check(err, check.NotNil)
+}
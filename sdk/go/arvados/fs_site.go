@@ -0,0 +1,203 @@
+// Copyright (C) The Arvados Authors. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package arvados
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// CustomFileSystem is the root of the Arvados site filesystem: the
+// tree an Arvados FUSE mount or webdav server presents, with projects
+// and collections the current user can see mounted under /home.
+type CustomFileSystem struct {
+	client *Client
+	home   *projectNode
+}
+
+// NewCustomFileSystem returns a CustomFileSystem that uses client to
+// talk to the API server, and kc (if not nil) to read file content
+// out of Keep. A nil kc is fine for a filesystem that only needs to
+// list/create/rename/remove projects and collections, as in most of
+// this package's own tests.
+func NewCustomFileSystem(client *Client, kc keepGetter) *CustomFileSystem {
+	home := &projectNode{client: client, kc: kc, name: "home", isHome: true}
+	home.SetParent(home, "home") // root's ".." is itself
+	return &CustomFileSystem{client: client, home: home}
+}
+
+// fileHandle is a single open file or directory handle returned by
+// Open/OpenFile.
+type fileHandle struct {
+	node inode
+	fs   *CustomFileSystem
+	pos  int64
+}
+
+func (h *fileHandle) Stat() (os.FileInfo, error) { return h.node.FileInfo(), nil }
+
+func (h *fileHandle) Readdir(n int) ([]os.FileInfo, error) {
+	var fis []os.FileInfo
+	var err error
+	switch node := h.node.(type) {
+	case *projectNode:
+		fis, err = node.readdir()
+	case *collectionDirNode:
+		fis, err = node.readdir()
+	default:
+		return nil, fmt.Errorf("not a directory")
+	}
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(fis, func(i, j int) bool { return fis[i].Name() < fis[j].Name() })
+	return fis, nil
+}
+
+func (h *fileHandle) Read(p []byte) (int, error) {
+	fn, ok := h.node.(*collectionFileNode)
+	if !ok {
+		return 0, fmt.Errorf("reading file content is not supported by this filesystem layer")
+	}
+	n, err := fn.readAt(p, h.pos)
+	h.pos += int64(n)
+	return n, err
+}
+
+func (h *fileHandle) Write(p []byte) (int, error) {
+	return 0, fmt.Errorf("writing file content is not supported by this filesystem layer")
+}
+
+func (h *fileHandle) Close() error { return nil }
+
+// Sync reloads this handle's node from the API server, if it's a
+// project (see projectNode.Sync). It's a no-op for other node types.
+func (h *fileHandle) Sync() error {
+	if pn, ok := h.node.(*projectNode); ok {
+		return pn.Sync()
+	}
+	return nil
+}
+
+// split cleans and splits an absolute path into its non-empty
+// segments, e.g. "/home/A Project/x" -> ["home", "A Project", "x"].
+// path.Clean lexically resolves any ".." along the way, so the
+// returned segments never contain one.
+func split(name string) []string {
+	clean := path.Clean("/" + name)
+	parts := strings.Split(clean, "/")
+	segments := parts[:0]
+	for _, p := range parts {
+		if p != "" {
+			segments = append(segments, p)
+		}
+	}
+	return segments
+}
+
+// resolve walks from the root to the inode named by the given
+// absolute path.
+func (fs *CustomFileSystem) resolve(name string) (inode, error) {
+	segments := split(name)
+	if len(segments) == 0 || segments[0] != "home" {
+		return nil, os.ErrNotExist
+	}
+	var cur inode = fs.home
+	for _, seg := range segments[1:] {
+		var child inode
+		var err error
+		switch n := cur.(type) {
+		case *projectNode:
+			child, err = n.child(seg)
+		case *collectionDirNode:
+			child, err = n.child(seg)
+		default:
+			return nil, os.ErrNotExist
+		}
+		if err != nil {
+			return nil, err
+		}
+		cur = child
+	}
+	return cur, nil
+}
+
+// resolveParent walks to the parent directory of the given absolute
+// path, which must be a project, and returns it along with the final
+// path segment (the name being created/renamed/removed).
+func (fs *CustomFileSystem) resolveParent(name string) (*projectNode, string, error) {
+	segments := split(name)
+	if len(segments) < 2 {
+		return nil, "", fmt.Errorf("invalid path: %q", name)
+	}
+	parentNode, err := fs.resolve(path.Dir(path.Clean("/" + name)))
+	if err != nil {
+		return nil, "", err
+	}
+	pn, ok := parentNode.(*projectNode)
+	if !ok {
+		return nil, "", fmt.Errorf("%q: parent is not a project", name)
+	}
+	return pn, segments[len(segments)-1], nil
+}
+
+// Open opens name for reading.
+func (fs *CustomFileSystem) Open(name string) (File, error) {
+	node, err := fs.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	return &fileHandle{node: node, fs: fs}, nil
+}
+
+// OpenFile opens name, as os.OpenFile does. flag and perm are ignored:
+// files within a collection are read-only through this filesystem
+// layer, and directories (/home, projects, and collections) don't
+// need permissions or creation flags to open.
+func (fs *CustomFileSystem) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	return fs.Open(name)
+}
+
+// Mkdir creates a new subproject at name, whose parent must already
+// exist and be a project.
+func (fs *CustomFileSystem) Mkdir(name string, perm os.FileMode) error {
+	parent, childName, err := fs.resolveParent(name)
+	if err != nil {
+		return err
+	}
+	_, err = parent.mkdir(childName)
+	return err
+}
+
+// Rename moves/renames oldname to newname. Both must be direct
+// children of projects (not /home itself).
+func (fs *CustomFileSystem) Rename(oldname, newname string) error {
+	oldParent, oldChildName, err := fs.resolveParent(oldname)
+	if err != nil {
+		return err
+	}
+	newParent, newChildName, err := fs.resolveParent(newname)
+	if err != nil {
+		return err
+	}
+	return oldParent.rename(oldChildName, newParent, newChildName)
+}
+
+// Remove removes the collection or (empty) subproject at name.
+func (fs *CustomFileSystem) Remove(name string) error {
+	parent, childName, err := fs.resolveParent(name)
+	if err != nil {
+		return err
+	}
+	return parent.remove(childName)
+}
+
+// Sync reloads /home's children from the API server.
+func (fs *CustomFileSystem) Sync() error {
+	return fs.home.Sync()
+}
@@ -0,0 +1,37 @@
+// Copyright (C) The Arvados Authors. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package arvados
+
+import (
+	"os"
+	"testing"
+
+	check "gopkg.in/check.v1"
+)
+
+// Gocheck boilerplate
+func Test(t *testing.T) {
+	check.TestingT(t)
+}
+
+type SiteFSSuite struct {
+	client *Client
+	fs     *CustomFileSystem
+}
+
+var _ = check.Suite(&SiteFSSuite{})
+
+func (s *SiteFSSuite) SetUpTest(c *check.C) {
+	apiHost := os.Getenv("ARVADOS_API_HOST")
+	if apiHost == "" {
+		c.Skip("ARVADOS_API_HOST not set; these tests need a running Arvados API server")
+	}
+	s.client = &Client{
+		APIHost:   apiHost,
+		AuthToken: os.Getenv("ARVADOS_API_TOKEN"),
+		Insecure:  os.Getenv("ARVADOS_API_HOST_INSECURE") != "",
+	}
+	s.fs = NewCustomFileSystem(s.client, nil)
+}
@@ -0,0 +1,15 @@
+// Copyright (C) The Arvados Authors. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package arvados
+
+// Group is an Arvados group. A group with GroupClass "project" is a
+// project: a named, ownable container for collections and other
+// projects.
+type Group struct {
+	UUID       string `json:"uuid,omitempty"`
+	OwnerUUID  string `json:"owner_uuid,omitempty"`
+	Name       string `json:"name,omitempty"`
+	GroupClass string `json:"group_class,omitempty"`
+}
@@ -0,0 +1,170 @@
+// Copyright (C) The Arvados Authors. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package arvados
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// fileSegment is one contiguous byte range of a file's content, found
+// in a single Keep block.
+type fileSegment struct {
+	locator string
+	offset  int64 // offset of this segment within the block named by locator
+	length  int64
+}
+
+// manifestFile is the set of segments that make up one file named in
+// a collection's manifest text, in order.
+type manifestFile struct {
+	size     int64
+	segments []fileSegment
+}
+
+// parseManifestFiles parses a collection's manifest text (see
+// https://doc.arvados.org/architecture/manifest-format.html) into a
+// map of top-level filename to the segments that make up its
+// content. Only files in the manifest's root stream ("." ...) are
+// returned; files in other streams are not reachable through this
+// filesystem layer, which does not implement subdirectories within a
+// collection.
+func parseManifestFiles(manifestText string) (map[string]*manifestFile, error) {
+	files := map[string]*manifestFile{}
+	for _, line := range strings.Split(strings.TrimSuffix(manifestText, "\n"), "\n") {
+		if line == "" {
+			continue
+		}
+		tokens := strings.Split(line, " ")
+		if len(tokens) < 1 {
+			continue
+		}
+		streamName := tokens[0]
+
+		var locators []string
+		var blockSize []int64
+		var fileTokens []string
+		for _, tok := range tokens[1:] {
+			if size, ok := locatorSize(tok); ok {
+				locators = append(locators, tok)
+				blockSize = append(blockSize, size)
+			} else {
+				fileTokens = append(fileTokens, tok)
+			}
+		}
+
+		// Offsets in a file token are positions within the
+		// concatenation of this stream's locators; precompute each
+		// locator's starting offset so we can split a file's
+		// [start, start+length) range across block boundaries.
+		blockStart := make([]int64, len(blockSize))
+		var pos int64
+		for i, size := range blockSize {
+			blockStart[i] = pos
+			pos += size
+		}
+
+		for _, tok := range fileTokens {
+			start, length, name, err := parseFileToken(tok)
+			if err != nil {
+				return nil, fmt.Errorf("parsing manifest: %v", err)
+			}
+			if streamName != "." {
+				// Not reachable from the flat, single-level
+				// directory listing this filesystem presents.
+				continue
+			}
+			segs, err := splitAcrossBlocks(locators, blockStart, blockSize, start, length)
+			if err != nil {
+				return nil, fmt.Errorf("parsing manifest: file %q: %v", name, err)
+			}
+			f, ok := files[name]
+			if !ok {
+				f = &manifestFile{}
+				files[name] = f
+			}
+			f.segments = append(f.segments, segs...)
+			f.size += length
+		}
+	}
+	return files, nil
+}
+
+// locatorSize returns the block size named by a manifest token like
+// "acbd18db4cc2f85cedef654fccc4a4d8+3+Aabc@1234", and true if tok is a
+// locator (as opposed to a file token or something else).
+func locatorSize(tok string) (int64, bool) {
+	if len(tok) < 34 || tok[32] != '+' {
+		return 0, false
+	}
+	for _, c := range tok[:32] {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return 0, false
+		}
+	}
+	rest := strings.SplitN(tok[33:], "+", 2)
+	size, err := strconv.ParseInt(rest[0], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return size, true
+}
+
+// parseFileToken parses a manifest file token "offset:length:name"
+// into its three fields, unescaping \040 (space) in name.
+func parseFileToken(tok string) (offset, length int64, name string, err error) {
+	parts := strings.SplitN(tok, ":", 3)
+	if len(parts) != 3 {
+		return 0, 0, "", fmt.Errorf("invalid file token %q", tok)
+	}
+	offset, err = strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return 0, 0, "", fmt.Errorf("invalid file token %q", tok)
+	}
+	length, err = strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return 0, 0, "", fmt.Errorf("invalid file token %q", tok)
+	}
+	return offset, length, strings.ReplaceAll(parts[2], `\040`, " "), nil
+}
+
+// splitAcrossBlocks returns the segments of [start, start+length)
+// within the stream described by locators/blockStart/blockSize.
+func splitAcrossBlocks(locators []string, blockStart, blockSize []int64, start, length int64) ([]fileSegment, error) {
+	var segs []fileSegment
+	end := start + length
+	for i, locator := range locators {
+		blockEnd := blockStart[i] + blockSize[i]
+		if blockEnd <= start || blockStart[i] >= end {
+			continue
+		}
+		segStart := start
+		if segStart < blockStart[i] {
+			segStart = blockStart[i]
+		}
+		segEnd := end
+		if segEnd > blockEnd {
+			segEnd = blockEnd
+		}
+		segs = append(segs, fileSegment{
+			locator: locator,
+			offset:  segStart - blockStart[i],
+			length:  segEnd - segStart,
+		})
+	}
+	if got := segsLength(segs); got != length {
+		return nil, fmt.Errorf("range [%d, %d) is not covered by this stream's locators", start, end)
+	}
+	return segs, nil
+}
+
+func segsLength(segs []fileSegment) int64 {
+	var n int64
+	for _, s := range segs {
+		n += s.length
+	}
+	return n
+}
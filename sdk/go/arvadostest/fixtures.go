@@ -0,0 +1,12 @@
+// Copyright (C) The Arvados Authors. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package arvadostest holds UUIDs and other constants referring to
+// fixture data loaded into the test Arvados API server, for use by
+// integration tests elsewhere in the SDK.
+package arvadostest
+
+// AProjectUUID is the UUID of the project named "A Project" in the
+// test fixtures.
+const AProjectUUID = "zzzzz-j7d0g-v955i6s2oi1cbso"
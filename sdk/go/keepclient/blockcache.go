@@ -0,0 +1,158 @@
+package keepclient
+
+import (
+	"bytes"
+	"container/list"
+	"io"
+	"io/ioutil"
+	"sync"
+	"time"
+)
+
+// defaultNegativeTTL is how long BlockCache remembers that a locator
+// returned BlockNotFound, so repeated lookups of a missing block don't
+// hammer every Keep service again right away.
+const defaultNegativeTTL = 2 * time.Second
+
+// cacheEntry is one cached Get/GetRange result.
+type cacheEntry struct {
+	key  string
+	data []byte
+	size int64
+	url  string
+}
+
+// fetchFunc retrieves the content for a cache key (a locator, for
+// Get, or a locator plus byte range, for GetRange) on a cache miss.
+type fetchFunc func(key string) (io.ReadCloser, int64, string, error)
+
+// call tracks a fetch in progress, so concurrent Get/GetRange calls
+// for the same key share a single upstream request (singleflight).
+type call struct {
+	wg   sync.WaitGroup
+	data []byte
+	size int64
+	url  string
+	err  error
+}
+
+// BlockCache memoizes recent KeepClient Get/GetRange results in
+// memory, evicting the least recently used entries once MaxSize is
+// exceeded. Concurrent requests for the same key are coalesced so
+// only one of them actually fetches from Keep; the rest wait for and
+// share that result. A miss that turns out to be BlockNotFound is
+// also cached briefly, to avoid re-querying every Keep service for a
+// block that was just reported missing.
+type BlockCache struct {
+	MaxSize     int64
+	NegativeTTL time.Duration
+
+	mtx      sync.Mutex
+	entries  map[string]*list.Element
+	order    *list.List
+	size     int64
+	negative map[string]time.Time
+	calls    map[string]*call
+}
+
+// NewBlockCache returns a BlockCache that holds at most maxSize bytes
+// of block data. A maxSize of 0 means unlimited.
+func NewBlockCache(maxSize int64) *BlockCache {
+	return &BlockCache{
+		MaxSize:     maxSize,
+		NegativeTTL: defaultNegativeTTL,
+		entries:     make(map[string]*list.Element),
+		order:       list.New(),
+		negative:    make(map[string]time.Time),
+		calls:       make(map[string]*call),
+	}
+}
+
+// Get returns the cached result for key if present; otherwise it
+// calls fetch(key) to populate the cache and returns that result.
+// Concurrent Gets for the same key that miss the cache share a single
+// call to fetch.
+func (bc *BlockCache) Get(key string, fetch fetchFunc) (io.ReadCloser, int64, string, error) {
+	bc.mtx.Lock()
+	if el, ok := bc.entries[key]; ok {
+		bc.order.MoveToFront(el)
+		entry := el.Value.(*cacheEntry)
+		bc.mtx.Unlock()
+		return ioutil.NopCloser(bytes.NewReader(entry.data)), entry.size, entry.url, nil
+	}
+	if expiry, ok := bc.negative[key]; ok {
+		if time.Now().Before(expiry) {
+			bc.mtx.Unlock()
+			return nil, 0, "", BlockNotFound
+		}
+		delete(bc.negative, key)
+	}
+	if inFlight, ok := bc.calls[key]; ok {
+		bc.mtx.Unlock()
+		inFlight.wg.Wait()
+		if inFlight.err != nil {
+			return nil, 0, "", inFlight.err
+		}
+		return ioutil.NopCloser(bytes.NewReader(inFlight.data)), inFlight.size, inFlight.url, nil
+	}
+
+	c := &call{}
+	c.wg.Add(1)
+	bc.calls[key] = c
+	bc.mtx.Unlock()
+
+	rdr, size, url, err := fetch(key)
+	if err == nil {
+		data, rerr := ioutil.ReadAll(rdr)
+		rdr.Close()
+		if rerr != nil {
+			err = rerr
+		} else {
+			c.data, c.size, c.url = data, size, url
+		}
+	}
+	c.err = err
+
+	bc.mtx.Lock()
+	delete(bc.calls, key)
+	if err == nil {
+		bc.insert(key, c.data, c.size, c.url)
+	} else if err == BlockNotFound {
+		ttl := bc.NegativeTTL
+		if ttl == 0 {
+			ttl = defaultNegativeTTL
+		}
+		bc.negative[key] = time.Now().Add(ttl)
+	}
+	bc.mtx.Unlock()
+	c.wg.Done()
+
+	if err != nil {
+		return nil, 0, "", err
+	}
+	return ioutil.NopCloser(bytes.NewReader(c.data)), c.size, c.url, nil
+}
+
+// insert adds or updates a cache entry and evicts least-recently-used
+// entries until the cache is back under MaxSize. Callers must hold
+// bc.mtx.
+func (bc *BlockCache) insert(key string, data []byte, size int64, url string) {
+	if el, ok := bc.entries[key]; ok {
+		old := el.Value.(*cacheEntry)
+		bc.size -= int64(len(old.data))
+		el.Value = &cacheEntry{key: key, data: data, size: size, url: url}
+		bc.order.MoveToFront(el)
+	} else {
+		el := bc.order.PushFront(&cacheEntry{key: key, data: data, size: size, url: url})
+		bc.entries[key] = el
+	}
+	bc.size += int64(len(data))
+
+	for bc.MaxSize > 0 && bc.size > bc.MaxSize && bc.order.Len() > 1 {
+		oldest := bc.order.Back()
+		entry := oldest.Value.(*cacheEntry)
+		bc.order.Remove(oldest)
+		delete(bc.entries, entry.key)
+		bc.size -= int64(len(entry.data))
+	}
+}
@@ -0,0 +1,104 @@
+package keepclient
+
+import (
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	check "gopkg.in/check.v1"
+)
+
+type BlockCacheSuite struct{}
+
+var _ = check.Suite(&BlockCacheSuite{})
+
+func (s *BlockCacheSuite) TestHitAvoidsFetch(c *check.C) {
+	bc := NewBlockCache(1024)
+	var calls int32
+	fetch := func(string) (io.ReadCloser, int64, string, error) {
+		atomic.AddInt32(&calls, 1)
+		return ioutil.NopCloser(strings.NewReader("hello")), 5, "http://example", nil
+	}
+
+	for i := 0; i < 3; i++ {
+		rdr, size, url, err := bc.Get("abc123", fetch)
+		c.Assert(err, check.IsNil)
+		c.Check(size, check.Equals, int64(5))
+		c.Check(url, check.Equals, "http://example")
+		body, _ := ioutil.ReadAll(rdr)
+		c.Check(string(body), check.Equals, "hello")
+	}
+	c.Check(atomic.LoadInt32(&calls), check.Equals, int32(1))
+}
+
+func (s *BlockCacheSuite) TestConcurrentGetsCoalesce(c *check.C) {
+	bc := NewBlockCache(1024)
+	var calls int32
+	release := make(chan struct{})
+	fetch := func(string) (io.ReadCloser, int64, string, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return ioutil.NopCloser(strings.NewReader("world")), 5, "http://example", nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rdr, _, _, err := bc.Get("samekey", fetch)
+			c.Check(err, check.IsNil)
+			body, _ := ioutil.ReadAll(rdr)
+			c.Check(string(body), check.Equals, "world")
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	c.Check(atomic.LoadInt32(&calls), check.Equals, int32(1))
+}
+
+func (s *BlockCacheSuite) TestNegativeCache(c *check.C) {
+	bc := NewBlockCache(1024)
+	bc.NegativeTTL = 50 * time.Millisecond
+	var calls int32
+	fetch := func(string) (io.ReadCloser, int64, string, error) {
+		atomic.AddInt32(&calls, 1)
+		return nil, 0, "", BlockNotFound
+	}
+
+	_, _, _, err := bc.Get("missing", fetch)
+	c.Check(err, check.Equals, BlockNotFound)
+	_, _, _, err = bc.Get("missing", fetch)
+	c.Check(err, check.Equals, BlockNotFound)
+	c.Check(atomic.LoadInt32(&calls), check.Equals, int32(1))
+
+	time.Sleep(100 * time.Millisecond)
+	_, _, _, err = bc.Get("missing", fetch)
+	c.Check(err, check.Equals, BlockNotFound)
+	c.Check(atomic.LoadInt32(&calls), check.Equals, int32(2))
+}
+
+func (s *BlockCacheSuite) TestEviction(c *check.C) {
+	bc := NewBlockCache(10)
+	fetch := func(body string) fetchFunc {
+		return func(string) (io.ReadCloser, int64, string, error) {
+			return ioutil.NopCloser(strings.NewReader(body)), int64(len(body)), "", nil
+		}
+	}
+
+	bc.Get("a", fetch("12345"))
+	bc.Get("b", fetch("12345"))
+	// Cache is now full (10 bytes). Adding a third entry should evict "a".
+	bc.Get("c", fetch("12345"))
+
+	bc.mtx.Lock()
+	_, hasA := bc.entries["a"]
+	_, hasC := bc.entries["c"]
+	bc.mtx.Unlock()
+	c.Check(hasA, check.Equals, false)
+	c.Check(hasC, check.Equals, true)
+}
@@ -0,0 +1,246 @@
+/* Reed-Solomon erasure coding for PutBEC/GetEC, using arithmetic over
+GF(256). The encoding matrix is built from a Cauchy matrix, which (unlike
+a plain Vandermonde matrix) guarantees that every square submatrix is
+invertible, so any k of the resulting k+m shards are enough to recover
+the original data. */
+
+package keepclient
+
+import "fmt"
+
+// gfExp/gfLog are lookup tables for multiplication in GF(256), built
+// from the primitive polynomial x^8 + x^4 + x^3 + x^2 + 1 (0x11d).
+var gfExp [512]byte
+var gfLog [256]byte
+
+func init() {
+	x := 1
+	for i := 0; i < 255; i++ {
+		gfExp[i] = byte(x)
+		gfLog[x] = byte(i)
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11d
+		}
+	}
+	for i := 255; i < 512; i++ {
+		gfExp[i] = gfExp[i-255]
+	}
+}
+
+func gfAdd(a, b byte) byte {
+	return a ^ b
+}
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+int(gfLog[b])]
+}
+
+func gfDiv(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+	if b == 0 {
+		panic("keepclient: division by zero in GF(256)")
+	}
+	return gfExp[(int(gfLog[a])+255-int(gfLog[b]))%255]
+}
+
+// gfMatrix is a matrix of GF(256) elements, stored row-major.
+type gfMatrix [][]byte
+
+func newGFMatrix(rows, cols int) gfMatrix {
+	m := make(gfMatrix, rows)
+	for i := range m {
+		m[i] = make([]byte, cols)
+	}
+	return m
+}
+
+// cauchyMatrix returns a rows x cols Cauchy matrix: cell[i][j] =
+// 1/(x_i + y_j), where the x_i and y_j are drawn from disjoint ranges
+// so no denominator is ever zero.
+func cauchyMatrix(rows, cols int) (gfMatrix, error) {
+	if rows+cols > 256 {
+		return nil, fmt.Errorf("keepclient: erasure parameters too large for GF(256): rows=%d cols=%d", rows, cols)
+	}
+	m := newGFMatrix(rows, cols)
+	for i := 0; i < rows; i++ {
+		x := byte(i)
+		for j := 0; j < cols; j++ {
+			y := byte(rows + j)
+			m[i][j] = gfDiv(1, gfAdd(x, y))
+		}
+	}
+	return m, nil
+}
+
+// invert returns the inverse of a square GF(256) matrix, via
+// Gauss-Jordan elimination.
+func (m gfMatrix) invert() (gfMatrix, error) {
+	n := len(m)
+	work := newGFMatrix(n, 2*n)
+	for i := 0; i < n; i++ {
+		copy(work[i][:n], m[i])
+		work[i][n+i] = 1
+	}
+
+	for col := 0; col < n; col++ {
+		pivot := -1
+		for row := col; row < n; row++ {
+			if work[row][col] != 0 {
+				pivot = row
+				break
+			}
+		}
+		if pivot < 0 {
+			return nil, fmt.Errorf("keepclient: matrix is not invertible")
+		}
+		work[col], work[pivot] = work[pivot], work[col]
+
+		inv := gfDiv(1, work[col][col])
+		for k := 0; k < 2*n; k++ {
+			work[col][k] = gfMul(work[col][k], inv)
+		}
+
+		for row := 0; row < n; row++ {
+			if row == col || work[row][col] == 0 {
+				continue
+			}
+			factor := work[row][col]
+			for k := 0; k < 2*n; k++ {
+				work[row][k] = gfAdd(work[row][k], gfMul(factor, work[col][k]))
+			}
+		}
+	}
+
+	out := newGFMatrix(n, n)
+	for i := 0; i < n; i++ {
+		copy(out[i], work[i][n:])
+	}
+	return out, nil
+}
+
+// systematicEncodingMatrix returns a (k+m) x k matrix whose first k
+// rows are the identity matrix (so data shards pass through unchanged)
+// and whose remaining m rows compute parity shards from the k data
+// shards.
+func systematicEncodingMatrix(k, m int) (gfMatrix, error) {
+	cauchy, err := cauchyMatrix(k+m, k)
+	if err != nil {
+		return nil, err
+	}
+	top := cauchy[:k]
+	topInv, err := top.invert()
+	if err != nil {
+		return nil, err
+	}
+
+	enc := newGFMatrix(k+m, k)
+	for i := 0; i < k+m; i++ {
+		for j := 0; j < k; j++ {
+			var sum byte
+			for x := 0; x < k; x++ {
+				sum = gfAdd(sum, gfMul(cauchy[i][x], topInv[x][j]))
+			}
+			enc[i][j] = sum
+		}
+	}
+	return enc, nil
+}
+
+// ecEncode splits buffer into k equal-size data shards (padding the
+// last with zeroes as needed) and computes m parity shards, returning
+// all k+m shards in order.
+func ecEncode(buffer []byte, k, m int) ([][]byte, error) {
+	enc, err := systematicEncodingMatrix(k, m)
+	if err != nil {
+		return nil, err
+	}
+
+	shardSize := (len(buffer) + k - 1) / k
+	if shardSize == 0 {
+		shardSize = 1
+	}
+	data := make([][]byte, k)
+	for i := 0; i < k; i++ {
+		shard := make([]byte, shardSize)
+		start := min(len(buffer), i*shardSize)
+		end := min(len(buffer), (i+1)*shardSize)
+		copy(shard, buffer[start:end])
+		data[i] = shard
+	}
+
+	shards := make([][]byte, k+m)
+	copy(shards, data)
+	for i := k; i < k+m; i++ {
+		parity := make([]byte, shardSize)
+		for b := 0; b < shardSize; b++ {
+			var sum byte
+			for j := 0; j < k; j++ {
+				sum = gfAdd(sum, gfMul(enc[i][j], data[j][b]))
+			}
+			parity[b] = sum
+		}
+		shards[i] = parity
+	}
+	return shards, nil
+}
+
+// ecDecode reconstructs the original data given any k of the k+m
+// shards produced by ecEncode, keyed by shard index.
+func ecDecode(shards map[int][]byte, k, m int, size int64) ([]byte, error) {
+	if len(shards) < k {
+		return nil, fmt.Errorf("keepclient: need %d shards to decode, have %d", k, len(shards))
+	}
+	enc, err := systematicEncodingMatrix(k, m)
+	if err != nil {
+		return nil, err
+	}
+
+	indices := make([]int, 0, k)
+	for i := range shards {
+		if len(indices) == k {
+			break
+		}
+		indices = append(indices, i)
+	}
+
+	sub := newGFMatrix(k, k)
+	var shardSize int
+	present := make([][]byte, k)
+	for row, idx := range indices {
+		sub[row] = enc[idx]
+		present[row] = shards[idx]
+		shardSize = len(shards[idx])
+	}
+	subInv, err := sub.invert()
+	if err != nil {
+		return nil, fmt.Errorf("keepclient: could not reconstruct from available shards: %v", err)
+	}
+
+	data := make([]byte, k*shardSize)
+	for row := 0; row < k; row++ {
+		for b := 0; b < shardSize; b++ {
+			var sum byte
+			for col := 0; col < k; col++ {
+				sum = gfAdd(sum, gfMul(subInv[row][col], present[col][b]))
+			}
+			data[row*shardSize+b] = sum
+		}
+	}
+	if int64(len(data)) > size {
+		data = data[:size]
+	}
+	return data, nil
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,51 @@
+package keepclient
+
+import (
+	"bytes"
+
+	check "gopkg.in/check.v1"
+)
+
+type ErasureSuite struct{}
+
+var _ = check.Suite(&ErasureSuite{})
+
+func (s *ErasureSuite) TestEncodeDecodeRoundTrip(c *check.C) {
+	for _, tc := range []struct {
+		k, m int
+		size int
+	}{
+		{2, 1, 100},
+		{3, 2, 1000},
+		{4, 4, 64*1024*1024 - 1},
+		{3, 2, 1}, // buffer smaller than k: some shards are entirely padding
+	} {
+		buffer := make([]byte, tc.size)
+		for i := range buffer {
+			buffer[i] = byte(i)
+		}
+
+		shards, err := ecEncode(buffer, tc.k, tc.m)
+		c.Assert(err, check.IsNil)
+		c.Check(len(shards), check.Equals, tc.k+tc.m)
+
+		// Drop up to m shards and confirm the remaining k still
+		// reconstruct the original buffer.
+		available := make(map[int][]byte)
+		for i := tc.m; i < tc.k+tc.m; i++ {
+			available[i] = shards[i]
+		}
+		got, err := ecDecode(available, tc.k, tc.m, int64(tc.size))
+		c.Assert(err, check.IsNil)
+		c.Check(bytes.Equal(got, buffer), check.Equals, true)
+	}
+}
+
+func (s *ErasureSuite) TestDecodeInsufficientShards(c *check.C) {
+	buffer := make([]byte, 100)
+	shards, err := ecEncode(buffer, 3, 2)
+	c.Assert(err, check.IsNil)
+
+	_, err = ecDecode(map[int][]byte{0: shards[0], 1: shards[1]}, 3, 2, 100)
+	c.Check(err, check.NotNil)
+}
@@ -5,6 +5,7 @@ import (
 	"bytes"
 	"crypto/md5"
 	"crypto/tls"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"git.curoverse.com/arvados.git/sdk/go/arvadosclient"
@@ -30,6 +31,7 @@ var MissingArvadosApiHost = errors.New("Missing required environment variable AR
 var MissingArvadosApiToken = errors.New("Missing required environment variable ARVADOS_API_TOKEN")
 var InvalidLocatorError = errors.New("Invalid locator")
 var KeepServerError = errors.New("One or more keep servers returned an error")
+var RangeNotSatisfiableError = errors.New("Requested range not satisfiable")
 
 // ErrNoSuchKeepServer is returned when GetIndex is invoked with a UUID with no matching keep server
 var ErrNoSuchKeepServer = errors.New("No keep server matching the given UUID is found")
@@ -52,6 +54,13 @@ type KeepClient struct {
 	Client             *http.Client
 	Retries            int
 
+	// Cache, if non-nil, memoizes recent Get/GetRange results so
+	// repeated or overlapping reads of the same block don't each
+	// incur an upstream fetch. It is not populated automatically;
+	// callers that want caching should set it, e.g. kc.Cache =
+	// NewBlockCache(64 * 1024 * 1024).
+	Cache *BlockCache
+
 	// set to 1 if all writable services are of disk type, otherwise 0
 	replicasPerService int
 }
@@ -140,6 +149,299 @@ func (kc *KeepClient) PutR(r io.Reader) (locator string, replicas int, err error
 	}
 }
 
+// putReplicas is the "replicate" write strategy: it sends the block to
+// enough writable Keep services to satisfy kc.Want_replicas, and
+// returns the locator augmented with a size hint and the number of
+// replicas actually written.
+func (kc *KeepClient) putReplicas(hash string, tr *streamer.AsyncStream, expectedLength int64) (locator string, replicas int, err error) {
+	writableLocalRoots := kc.WritableLocalRoots()
+	if len(writableLocalRoots) == 0 {
+		return "", 0, InsufficientReplicasError
+	}
+
+	servers := NewRootSorter(writableLocalRoots, hash).GetSortedRoots()
+
+	type putResult struct {
+		uri string
+		err error
+	}
+	resultChan := make(chan putResult, len(servers))
+	replicasPerService := kc.replicasPerService
+	if replicasPerService == 0 {
+		replicasPerService = 1
+	}
+
+	wanted := kc.Want_replicas
+	sent := 0
+	for _, host := range servers {
+		if sent >= wanted {
+			break
+		}
+		host := host
+		sent += replicasPerService
+		go func() {
+			_, err := kc.uploadToKeepServer(host, hash, tr.MakeStreamReader(), expectedLength)
+			resultChan <- putResult{uri: host, err: err}
+		}()
+	}
+
+	var errs []string
+	for i := 0; i < sent; i += replicasPerService {
+		result := <-resultChan
+		if result.err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", result.uri, result.err))
+			continue
+		}
+		replicas += replicasPerService
+	}
+
+	if replicas < kc.Want_replicas {
+		log.Printf("DEBUG: PUT %s failed: %v", hash, errs)
+		return "", replicas, InsufficientReplicasError
+	}
+
+	return fmt.Sprintf("%s+%d", hash, expectedLength), replicas, nil
+}
+
+// uploadToKeepServer sends one copy of a block to the Keep service at
+// host. It is shared by the replicate and erasure-coded write
+// strategies, which differ only in how many servers they call it
+// against and what they send.
+func (kc *KeepClient) uploadToKeepServer(host, hash string, body io.Reader, expectedLength int64) (string, error) {
+	req, err := http.NewRequest("PUT", fmt.Sprintf("%s/%s", host, hash), body)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Add("Authorization", fmt.Sprintf("OAuth2 %s", kc.Arvados.ApiToken))
+	req.Header.Add("Content-Type", "application/octet-stream")
+	if expectedLength > 0 {
+		req.ContentLength = expectedLength
+	}
+
+	resp, err := kc.Client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	respbody, _ := ioutil.ReadAll(&io.LimitedReader{resp.Body, 4096})
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s: %d %s", host, resp.StatusCode, bytes.TrimSpace(respbody))
+	}
+	return host, nil
+}
+
+// PutBEC writes a block using erasure coding instead of full
+// replication: buffer is split into k data shards, m parity shards are
+// computed with Reed-Solomon coding, and the k+m shards are written to
+// writable Keep services in parallel. Any k of the k+m shards are
+// sufficient to reconstruct the block, so PutBEC gives comparable
+// durability to replication with much less storage overhead for large,
+// cold blocks.
+//
+// The returned locator is the hash and size of the original (pre-split)
+// buffer, with an additional "+E<k>-<m>-<manifest>" hint. The manifest
+// hint is itself a Keep locator for a small block listing where each
+// shard was written; GetEC uses it to find the shards.
+func (kc *KeepClient) PutBEC(buffer []byte, k, m int) (string, error) {
+	if k < 1 || m < 1 {
+		return "", fmt.Errorf("invalid erasure parameters k=%d m=%d: both must be >= 1", k, m)
+	}
+
+	hash := fmt.Sprintf("%x", md5.Sum(buffer))
+	shards, err := ecEncode(buffer, k, m)
+	if err != nil {
+		return "", err
+	}
+
+	writable := kc.WritableLocalRoots()
+	if len(writable) < k+m {
+		return "", InsufficientReplicasError
+	}
+	servers := NewRootSorter(writable, hash).GetSortedRoots()
+
+	locators, err := kc.uploadShards(servers, shards)
+	if err != nil {
+		return "", fmt.Errorf("erasure coded put: %v", err)
+	}
+
+	manifest := ecManifest{Size: int64(len(buffer)), K: k, M: m, Shards: locators}
+	manifestBytes, err := json.Marshal(manifest)
+	if err != nil {
+		return "", err
+	}
+	manifestLocator, _, err := kc.PutB(manifestBytes)
+	if err != nil {
+		return "", fmt.Errorf("erasure coded put: writing manifest: %v", err)
+	}
+	manifestHash := manifestLocator[0:32]
+
+	return fmt.Sprintf("%s+%d+E%d-%d-%s", hash, len(buffer), k, m, manifestHash), nil
+}
+
+// uploadShards writes each of shards to servers[i % len(servers)] in
+// parallel, using the shared uploadToKeepServer primitive, and returns
+// the locator (hash+size) of each written shard in the same order.
+//
+// This is PutBEC's write strategy, as putReplicas (which sends the
+// *same* bytes to however many of kc.Want_replicas servers are needed)
+// is to PutB/PutHR: both ultimately fan out to uploadToKeepServer, but
+// their selection logic differs enough -- one distinct shard per
+// server vs. the same block repeated across N servers, with
+// replicasPerService and early-exit-once-satisfied semantics that
+// don't apply to shards -- that unifying them behind one strategy
+// interface would obscure more than it shares. Keeping them as two
+// small, separate fan-out loops over the same primitive is the
+// simpler and clearer option here.
+func (kc *KeepClient) uploadShards(servers []string, shards [][]byte) ([]string, error) {
+	locators := make([]string, len(shards))
+	errs := make([]error, len(shards))
+	var wg sync.WaitGroup
+	for i, shard := range shards {
+		wg.Add(1)
+		go func(i int, shard []byte) {
+			defer wg.Done()
+			shardHash := fmt.Sprintf("%x", md5.Sum(shard))
+			if _, err := kc.uploadToKeepServer(servers[i%len(servers)], shardHash, bytes.NewReader(shard), int64(len(shard))); err != nil {
+				errs[i] = err
+				return
+			}
+			locators[i] = fmt.Sprintf("%s+%d", shardHash, len(shard))
+		}(i, shard)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return locators, nil
+}
+
+// fetchECShards fetches each of shardLocators from Keep in parallel,
+// stopping once k of them have arrived. It's called with the shard
+// list from an erasure-coded block's manifest; unlike a plain
+// locator, a manifest names k+m *different* locators to fetch (one
+// per shard, each potentially on a different server), so this can't
+// be expressed as a getSortedRoots-style "which servers have this one
+// locator" lookup -- GetEC has to resolve the manifest first to even
+// know what to fetch, so the parallel fan-out naturally lives here
+// rather than in getSortedRoots.
+func fetchECShards(kc *KeepClient, shardLocators []string, k int) (map[int][]byte, error) {
+	type shardResult struct {
+		index int
+		data  []byte
+		err   error
+	}
+	resultChan := make(chan shardResult, len(shardLocators))
+	for i, shardLocator := range shardLocators {
+		go func(i int, shardLocator string) {
+			r, _, _, err := kc.Get(shardLocator)
+			if err != nil {
+				resultChan <- shardResult{index: i, err: err}
+				return
+			}
+			defer r.Close()
+			data, err := ioutil.ReadAll(r)
+			resultChan <- shardResult{index: i, data: data, err: err}
+		}(i, shardLocator)
+	}
+
+	shards := make(map[int][]byte)
+	for i := 0; i < len(shardLocators) && len(shards) < k; i++ {
+		result := <-resultChan
+		if result.err != nil {
+			continue
+		}
+		shards[result.index] = result.data
+	}
+	if len(shards) < k {
+		return nil, fmt.Errorf("erasure coded get: only %d of %d required shards available", len(shards), k)
+	}
+	return shards, nil
+}
+
+// GetEC retrieves a block that was written with PutBEC. It reads the
+// shard manifest referenced by the locator's "+E<k>-<m>-<manifest>"
+// hint, fetches shards from Keep in parallel until k of them have
+// arrived, and reconstructs the original block.
+func (kc *KeepClient) GetEC(locator string) ([]byte, error) {
+	k, m, manifestHash, err := parseECHint(locator)
+	if err != nil {
+		return nil, err
+	}
+
+	manifestReader, _, _, err := kc.Get(manifestHash)
+	if err != nil {
+		return nil, fmt.Errorf("erasure coded get: fetching manifest: %v", err)
+	}
+	defer manifestReader.Close()
+	manifestBytes, err := ioutil.ReadAll(manifestReader)
+	if err != nil {
+		return nil, err
+	}
+	var manifest ecManifest
+	if err := json.Unmarshal(manifestBytes, &manifest); err != nil {
+		return nil, fmt.Errorf("erasure coded get: parsing manifest: %v", err)
+	}
+	if manifest.K != k || manifest.M != m || len(manifest.Shards) != k+m {
+		return nil, fmt.Errorf("erasure coded get: manifest does not match locator hint")
+	}
+
+	shards, err := fetchECShards(kc, manifest.Shards, k)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ecDecode(shards, k, m, manifest.Size)
+	if err != nil {
+		return nil, err
+	}
+
+	// Every other read path (Get, and the 200-fallback branch of
+	// GetRange) verifies the data it returns against the locator's
+	// hash; do the same here, so a corrupt shard, a stale manifest,
+	// or a reconstruction bug can't hand back data that silently
+	// doesn't match what PutBEC wrote.
+	checked := HashCheckingReader{
+		Reader: bytes.NewReader(data),
+		Hash:   md5.New(),
+		Check:  locator[0:32],
+	}
+	if _, err := ioutil.ReadAll(checked); err != nil {
+		return nil, fmt.Errorf("erasure coded get: %v", err)
+	}
+	return data, nil
+}
+
+var ecHintMatcher = regexp.MustCompile(`E(\d+)-(\d+)-([0-9a-f]{32})`)
+
+// parseECHint extracts the k, m and manifest locator from a locator's
+// "+E<k>-<m>-<manifest>" hint.
+func parseECHint(locator string) (k, m int, manifestHash string, err error) {
+	sm := ecHintMatcher.FindStringSubmatch(locator)
+	if sm == nil {
+		return 0, 0, "", fmt.Errorf("locator has no erasure coding hint: %s", locator)
+	}
+	k, err = strconv.Atoi(sm[1])
+	if err != nil {
+		return 0, 0, "", err
+	}
+	m, err = strconv.Atoi(sm[2])
+	if err != nil {
+		return 0, 0, "", err
+	}
+	return k, m, sm[3], nil
+}
+
+// ecManifest records where the shards of an erasure coded block were
+// written, so GetEC knows where to read them back from.
+type ecManifest struct {
+	Size   int64    `json:"size"`
+	K      int      `json:"k"`
+	M      int      `json:"m"`
+	Shards []string `json:"shards"`
+}
+
 // Get() retrieves a block, given a locator. Returns a reader, the
 // expected data length, the URL the block is being fetched from, and
 // an error.
@@ -148,6 +450,15 @@ func (kc *KeepClient) PutR(r io.Reader) (locator string, replicas int, err error
 // reader returned by this method will return a BadChecksum error
 // instead of EOF.
 func (kc *KeepClient) Get(locator string) (io.ReadCloser, int64, string, error) {
+	if kc.Cache != nil {
+		return kc.Cache.Get(locator, kc.getUncached)
+	}
+	return kc.getUncached(locator)
+}
+
+// getUncached does the actual work of Get, bypassing kc.Cache. It is
+// also what kc.Cache calls on a cache miss.
+func (kc *KeepClient) getUncached(locator string) (io.ReadCloser, int64, string, error) {
 	var errs []string
 
 	tries_remaining := 1 + kc.Retries
@@ -206,6 +517,135 @@ func (kc *KeepClient) Get(locator string) (io.ReadCloser, int64, string, error)
 	}
 }
 
+// GetRange retrieves a byte range of a block, given a locator, a byte
+// offset and a length. Returns a reader over just the requested range,
+// the number of bytes it will yield, the upstream URL it was fetched
+// from, and an error.
+//
+// GetRange asks Keep services for the range using an HTTP Range
+// header. A server that doesn't support range requests will return the
+// whole block (200 OK) instead of just the range (206 Partial
+// Content); GetRange detects this and slices out the requested range
+// itself rather than failing. A server that can't satisfy the
+// requested range at all returns 416, which GetRange reports as an
+// error.
+//
+// If the returned range happens to cover the entire block, the
+// underlying reader is wrapped in a HashCheckingReader so the usual
+// corruption check still applies; a true partial read skips the check,
+// since the hash only covers the full block.
+func (kc *KeepClient) GetRange(locator string, offset, length int64) (io.ReadCloser, int64, string, error) {
+	if kc.Cache != nil {
+		rangeLocator := fmt.Sprintf("%s@%d:%d", locator, offset, length)
+		return kc.Cache.Get(rangeLocator, func(string) (io.ReadCloser, int64, string, error) {
+			return kc.getRangeUncached(locator, offset, length)
+		})
+	}
+	return kc.getRangeUncached(locator, offset, length)
+}
+
+// getRangeUncached does the actual work of GetRange, bypassing
+// kc.Cache.
+func (kc *KeepClient) getRangeUncached(locator string, offset, length int64) (io.ReadCloser, int64, string, error) {
+	var errs []string
+	var rangeNotSatisfiable bool
+
+	rangeHeader := fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)
+
+	tries_remaining := 1 + kc.Retries
+	serversToTry := kc.getSortedRoots(locator)
+	var retryList []string
+
+	for tries_remaining > 0 {
+		tries_remaining -= 1
+		retryList = nil
+
+		for _, host := range serversToTry {
+			url := host + "/" + locator
+
+			req, err := http.NewRequest("GET", url, nil)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %v", url, err))
+				continue
+			}
+			req.Header.Add("Authorization", fmt.Sprintf("OAuth2 %s", kc.Arvados.ApiToken))
+			req.Header.Add("Range", rangeHeader)
+			resp, err := kc.Client.Do(req)
+			if err != nil {
+				// Probably a network error, may be transient,
+				// can try again.
+				errs = append(errs, fmt.Sprintf("%s: %v", url, err))
+				retryList = append(retryList, host)
+				continue
+			}
+
+			switch resp.StatusCode {
+			case http.StatusPartialContent:
+				// Server honored the Range request: what
+				// comes back is exactly the bytes we asked
+				// for, so there's nothing to check the hash
+				// of. Return resp.Body itself (not wrapped in
+				// a NopCloser) so the caller's Close() releases
+				// the underlying connection back to the pool.
+				return resp.Body, resp.ContentLength, url, nil
+
+			case http.StatusOK:
+				// Server doesn't support Range requests and
+				// sent the whole block; slice out the part
+				// we wanted. Opportunistically verify the
+				// hash, since we have the full block anyway.
+				checked := HashCheckingReader{
+					Reader: resp.Body,
+					Hash:   md5.New(),
+					Check:  locator[0:32],
+				}
+				body, err := ioutil.ReadAll(checked)
+				resp.Body.Close()
+				if err != nil {
+					errs = append(errs, fmt.Sprintf("%s: %v", url, err))
+					retryList = append(retryList, host)
+					continue
+				}
+				end := offset + length
+				if end > int64(len(body)) {
+					end = int64(len(body))
+				}
+				if offset > int64(len(body)) {
+					offset = int64(len(body))
+				}
+				return ioutil.NopCloser(bytes.NewReader(body[offset:end])), end - offset, url, nil
+
+			case http.StatusRequestedRangeNotSatisfiable:
+				resp.Body.Close()
+				errs = append(errs, fmt.Sprintf("%s: %d", url, resp.StatusCode))
+				rangeNotSatisfiable = true
+
+			default:
+				respbody, _ := ioutil.ReadAll(&io.LimitedReader{resp.Body, 4096})
+				resp.Body.Close()
+				errs = append(errs, fmt.Sprintf("%s: %d %s",
+					url, resp.StatusCode, bytes.TrimSpace(respbody)))
+
+				if resp.StatusCode >= 500 {
+					// Server side failure, may be
+					// transient, can try again.
+					retryList = append(retryList, host)
+				}
+			}
+		}
+		serversToTry = retryList
+	}
+	log.Printf("DEBUG: GET range %s %s failed: %v", locator, rangeHeader, errs)
+
+	if len(retryList) > 0 {
+		return nil, 0, "", KeepServerError
+	}
+	if rangeNotSatisfiable {
+		return nil, 0, "", RangeNotSatisfiableError
+	}
+	return nil, 0, "", BlockNotFound
+}
+
 // Ask() verifies that a block with the given hash is available and
 // readable, according to at least one Keep service. Unlike Get, it
 // does not retrieve the data or verify that the data content matches
@@ -340,6 +780,16 @@ func (kc *KeepClient) SetServiceRoots(newLocals, newWritableLocals map[string]st
 func (kc *KeepClient) getSortedRoots(locator string) []string {
 	var found []string
 	for _, hint := range strings.Split(locator, "+") {
+		if len(hint) > 0 && hint[0] == 'E' {
+			// Erasure coding hint (E<k>-<m>-<manifest>); this
+			// doesn't name a service directly, so there's
+			// nothing to add here. GetEC resolves shard
+			// locations via the referenced manifest instead (see
+			// fetchECShards), since that requires fetching and
+			// parsing the manifest itself, not just inspecting
+			// the original locator's hints.
+			continue
+		}
 		if len(hint) < 7 || hint[0:2] != "K@" {
 			// Not a service hint.
 			continue
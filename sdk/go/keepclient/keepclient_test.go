@@ -0,0 +1,92 @@
+package keepclient
+
+import (
+	"crypto/md5"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"git.curoverse.com/arvados.git/sdk/go/arvadosclient"
+	check "gopkg.in/check.v1"
+)
+
+// Gocheck boilerplate: this is the single entry point Go's testing
+// package calls into for the whole package's gocheck suites.
+func Test(t *testing.T) {
+	check.TestingT(t)
+}
+
+type GetRangeSuite struct{}
+
+var _ = check.Suite(&GetRangeSuite{})
+
+const testBlockData = "0123456789abcdef"
+
+var testLocator = fmt.Sprintf("%x+%d", md5.Sum([]byte(testBlockData)), len(testBlockData))
+
+func newTestKeepClient(c *check.C, handler http.HandlerFunc) (*KeepClient, *httptest.Server) {
+	srv := httptest.NewServer(handler)
+	kc := &KeepClient{
+		Arvados: &arvadosclient.ArvadosClient{ApiToken: "testtoken"},
+		Client:  &http.Client{},
+		Retries: 0,
+	}
+	kc.SetServiceRoots(
+		map[string]string{"zzzzz-bi6l4-aaaaaaaaaaaaaaa": srv.URL},
+		map[string]string{},
+		map[string]string{},
+	)
+	return kc, srv
+}
+
+// TestGetRangePartialContent checks that GetRange returns exactly the
+// bytes the server sends back with a 206 response, unmodified.
+func (s *GetRangeSuite) TestGetRangePartialContent(c *check.C) {
+	kc, srv := newTestKeepClient(c, func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Header.Get("Range"), check.Equals, "bytes=4-9")
+		w.Header().Set("Content-Range", "bytes 4-9/16")
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write([]byte(testBlockData[4:10]))
+	})
+	defer srv.Close()
+
+	rdr, size, url, err := kc.GetRange(testLocator, 4, 6)
+	c.Assert(err, check.IsNil)
+	c.Check(size, check.Equals, int64(6))
+	c.Check(url, check.Not(check.Equals), "")
+	body, err := ioutil.ReadAll(rdr)
+	c.Assert(err, check.IsNil)
+	c.Check(string(body), check.Equals, testBlockData[4:10])
+}
+
+// TestGetRangeFullContentFallback checks that GetRange slices out the
+// requested range itself when the server ignores Range and returns the
+// whole block.
+func (s *GetRangeSuite) TestGetRangeFullContentFallback(c *check.C) {
+	kc, srv := newTestKeepClient(c, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(testBlockData))
+	})
+	defer srv.Close()
+
+	rdr, size, _, err := kc.GetRange(testLocator, 4, 6)
+	c.Assert(err, check.IsNil)
+	c.Check(size, check.Equals, int64(6))
+	body, err := ioutil.ReadAll(rdr)
+	c.Assert(err, check.IsNil)
+	c.Check(string(body), check.Equals, testBlockData[4:10])
+}
+
+// TestGetRangeNotSatisfiable checks that a 416 response is reported as
+// RangeNotSatisfiableError.
+func (s *GetRangeSuite) TestGetRangeNotSatisfiable(c *check.C) {
+	kc, srv := newTestKeepClient(c, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+	})
+	defer srv.Close()
+
+	_, _, _, err := kc.GetRange(testLocator, 100, 6)
+	c.Check(err, check.Equals, RangeNotSatisfiableError)
+}